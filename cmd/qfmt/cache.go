@@ -0,0 +1,148 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// qfmtVersion is bumped whenever the formatting output of qfmt can change,
+// so stale cache entries from an older qfmt never get reused.
+const qfmtVersion = "1"
+
+// maxCacheAge and maxCacheBytes bound how much the on-disk cache is allowed
+// to grow; evict trims the oldest entries once either limit is hit.
+const (
+	maxCacheAge   = 30 * 24 * time.Hour
+	maxCacheBytes = 256 << 20 // 256MiB
+)
+
+// fmtCache is an on-disk, content-addressed cache of "this source is
+// already formatted" facts. It lets processFile skip parsing/formatting
+// entirely for files that haven't changed since the last -w run.
+type fmtCache struct {
+	dir string
+}
+
+// newFmtCache returns a cache rooted at dir, creating dir if necessary.
+// A zero-value (disabled) cache is returned if dir is empty or cannot be
+// created; callers treat that as an always-miss cache.
+func newFmtCache(dir string) *fmtCache {
+	if dir == "" {
+		return &fmtCache{}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return &fmtCache{}
+	}
+	return &fmtCache{dir: dir}
+}
+
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "qfmt")
+}
+
+// key returns the content-addressed cache key for src under the given
+// profile tag: the SHA-256 of the source bytes, the qfmt version and
+// profile, so that a change to any of them invalidates the entry. The
+// profile tag must capture everything that can change processFile's
+// output for identical src — the active mode (plain/-imports) and the
+// resolved .qfmt.toml settings — otherwise two different outputs could
+// collide on the same "already formatted" entry.
+func (c *fmtCache) key(src []byte, profile string) string {
+	h := sha256.New()
+	h.Write(src)
+	h.Write([]byte(qfmtVersion))
+	h.Write([]byte{0}) // separator, so src can't run into profile
+	h.Write([]byte(profile))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *fmtCache) path(key string) string {
+	if c.dir == "" {
+		return ""
+	}
+	return filepath.Join(c.dir, key)
+}
+
+// alreadyFormatted reports whether src is known, from a previous run
+// under the same profile, to already be in qfmt's canonical form.
+func (c *fmtCache) alreadyFormatted(src []byte, profile string) bool {
+	p := c.path(c.key(src, profile))
+	if p == "" {
+		return false
+	}
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// markFormatted records that src is already in qfmt's canonical form
+// under profile, so a later run with the same content and profile can
+// skip formatting it.
+func (c *fmtCache) markFormatted(src []byte, profile string) {
+	p := c.path(c.key(src, profile))
+	if p == "" {
+		return
+	}
+	// The entry only needs to exist; its contents are never read.
+	ioutil.WriteFile(p, nil, 0644)
+}
+
+// evict removes cache entries older than maxCacheAge, then, if the cache
+// is still larger than maxCacheBytes, removes the oldest remaining
+// entries until it fits.
+func (c *fmtCache) evict() {
+	if c.dir == "" {
+		return
+	}
+	entries, err := ioutil.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	var total int64
+	var live []os.FileInfo
+	for _, fi := range entries {
+		if now.Sub(fi.ModTime()) > maxCacheAge {
+			os.Remove(filepath.Join(c.dir, fi.Name()))
+			continue
+		}
+		total += fi.Size()
+		live = append(live, fi)
+	}
+	if total <= maxCacheBytes {
+		return
+	}
+	sort.Slice(live, func(i, j int) bool { return live[i].ModTime().Before(live[j].ModTime()) })
+	for _, fi := range live {
+		if total <= maxCacheBytes {
+			break
+		}
+		if err := os.Remove(filepath.Join(c.dir, fi.Name())); err == nil {
+			total -= fi.Size()
+		}
+	}
+}
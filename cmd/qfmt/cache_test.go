@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheKeyDiffersByProfile(t *testing.T) {
+	c := newFmtCache(t.TempDir())
+	src := []byte("package main\n")
+
+	if c.key(src, "plain") == c.key(src, "imports") {
+		t.Fatal("key(src, \"plain\") == key(src, \"imports\"); same content with a different mode must not collide")
+	}
+
+	a := defaultFmtConfig.cacheProfile("plain")
+	b := defaultFmtConfig
+	b.TabWidth = 2
+	if c.key(src, a) == c.key(src, b.cacheProfile("plain")) {
+		t.Fatal("two different .qfmt.toml profiles produced the same key for identical content")
+	}
+	if c.key(src, a) != c.key(src, defaultFmtConfig.cacheProfile("plain")) {
+		t.Fatal("same content and same profile produced different keys")
+	}
+}
+
+func TestCacheAlreadyFormattedRespectsProfile(t *testing.T) {
+	c := newFmtCache(t.TempDir())
+	src := []byte("package main\n")
+
+	c.markFormatted(src, "plain")
+	if !c.alreadyFormatted(src, "plain") {
+		t.Fatal("alreadyFormatted(src, \"plain\") = false after markFormatted(src, \"plain\")")
+	}
+	if c.alreadyFormatted(src, "imports") {
+		t.Fatal("alreadyFormatted(src, \"imports\") = true, but only \"plain\" was ever marked")
+	}
+}
+
+func TestCacheEvictByAge(t *testing.T) {
+	dir := t.TempDir()
+	c := newFmtCache(dir)
+
+	c.markFormatted([]byte("old"), "plain")
+	old := filepath.Join(dir, c.key([]byte("old"), "plain"))
+	oldTime := time.Now().Add(-2 * maxCacheAge)
+	if err := os.Chtimes(old, oldTime, oldTime); err != nil {
+		t.Fatal(err)
+	}
+
+	c.markFormatted([]byte("new"), "plain")
+
+	c.evict()
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Fatalf("entry older than maxCacheAge survived evict(): err=%v", err)
+	}
+	if !c.alreadyFormatted([]byte("new"), "plain") {
+		t.Fatal("evict() removed an entry well within maxCacheAge")
+	}
+}
+
+func TestCacheEvictBySize(t *testing.T) {
+	dir := t.TempDir()
+	c := &fmtCache{dir: dir}
+
+	// Write more than maxCacheBytes of entries, each with a distinct,
+	// increasing mtime so eviction order is deterministic.
+	const entrySize = maxCacheBytes/4 + 1
+	names := []string{"a", "b", "c", "d", "e"}
+	base := time.Now().Add(-time.Duration(len(names)) * time.Minute)
+	for i, name := range names {
+		p := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(p, make([]byte, entrySize), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.evict()
+
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Fatal("oldest entry should have been evicted once the cache exceeded maxCacheBytes")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "e")); err != nil {
+		t.Fatalf("newest entry should have survived evict(): %v", err)
+	}
+}
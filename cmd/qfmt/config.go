@@ -0,0 +1,253 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/goplus/gop/format"
+)
+
+// fmtConfig is a formatting profile as read from .qfmt.toml: either the
+// project-wide defaults or a per-glob override.
+type fmtConfig struct {
+	TabWidth    int
+	UseSpaces   bool
+	SortImports bool
+	Simplify    bool
+}
+
+// defaultFmtConfig mirrors qfmt's built-in constants, so a tree with no
+// .qfmt.toml formats exactly as it always has.
+var defaultFmtConfig = fmtConfig{
+	TabWidth:  tabWidth,
+	UseSpaces: true,
+}
+
+// override narrows a fmtConfig to files matching Glob, relative to the
+// directory the .qfmt.toml was found in.
+type override struct {
+	Glob string
+	fmtConfig
+}
+
+// projectConfig is one parsed .qfmt.toml: base settings plus any
+// per-glob [[overrides]].
+type projectConfig struct {
+	dir       string
+	base      fmtConfig
+	overrides []override
+}
+
+// resolve returns the fmtConfig that applies to filename, applying the
+// last matching override (if any) on top of the project base, the same
+// "most specific/last wins" rule .editorconfig uses.
+func (c *projectConfig) resolve(filename string) fmtConfig {
+	cfg := c.base
+	rel, err := filepath.Rel(c.dir, filename)
+	if err != nil {
+		return cfg
+	}
+	rel = filepath.ToSlash(rel)
+	for _, o := range c.overrides {
+		if matchGlob(o.Glob, rel) {
+			cfg = o.fmtConfig
+		}
+	}
+	return cfg
+}
+
+// matchGlob matches rel (a slash-separated relative path) against
+// pattern, which may use "**" to match zero or more path segments in
+// addition to filepath.Match's usual single-segment wildcards.
+func matchGlob(pattern, rel string) bool {
+	return matchGlobSegs(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchGlobSegs(pat, rel []string) bool {
+	if len(pat) == 0 {
+		return len(rel) == 0
+	}
+	if pat[0] == "**" {
+		if matchGlobSegs(pat[1:], rel) {
+			return true
+		}
+		return len(rel) > 0 && matchGlobSegs(pat, rel[1:])
+	}
+	if len(rel) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pat[0], rel[0]); !ok {
+		return false
+	}
+	return matchGlobSegs(pat[1:], rel[1:])
+}
+
+var (
+	configCacheMu sync.Mutex
+	configCache   = map[string]*projectConfig{} // keyed by directory searched from
+)
+
+// configFor returns the resolved fmtConfig for filename, discovering the
+// nearest .qfmt.toml by walking up from its directory. The discovered
+// (or absent) config is cached per starting directory, so formatting
+// many files in the same tree only walks and parses it once.
+func configFor(filename string) fmtConfig {
+	dir := filepath.Dir(filename)
+
+	configCacheMu.Lock()
+	pc, cached := configCache[dir]
+	configCacheMu.Unlock()
+	if cached {
+		if pc == nil {
+			return defaultFmtConfig
+		}
+		return pc.resolve(filename)
+	}
+
+	pc = findProjectConfig(dir)
+
+	configCacheMu.Lock()
+	configCache[dir] = pc
+	configCacheMu.Unlock()
+
+	if pc == nil {
+		return defaultFmtConfig
+	}
+	return pc.resolve(filename)
+}
+
+func findProjectConfig(dir string) *projectConfig {
+	for {
+		path := filepath.Join(dir, ".qfmt.toml")
+		if data, err := ioutil.ReadFile(path); err == nil {
+			pc, err := parseProjectConfig(dir, data)
+			if err == nil {
+				return pc
+			}
+			fmt.Fprintf(os.Stderr, "qfmt: %s: %v\n", path, err)
+			return nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil
+		}
+		dir = parent
+	}
+}
+
+// parseProjectConfig parses the restricted subset of TOML that
+// .qfmt.toml supports: top-level "key = value" pairs for the project
+// defaults, and "[[overrides]]" array-of-tables each starting with a
+// "glob" key. This intentionally isn't a general TOML parser.
+func parseProjectConfig(dir string, data []byte) (*projectConfig, error) {
+	pc := &projectConfig{dir: dir, base: defaultFmtConfig}
+	cur := &pc.base
+	var curOverride *override
+
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "[[overrides]]" {
+			pc.overrides = append(pc.overrides, override{fmtConfig: pc.base})
+			curOverride = &pc.overrides[len(pc.overrides)-1]
+			cur = &curOverride.fmtConfig
+			continue
+		}
+		key, val, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key = value\", got %q", n+1, line)
+		}
+		key = strings.TrimSpace(key)
+		val = strings.TrimSpace(strings.Trim(strings.TrimSpace(val), `"`))
+
+		if key == "glob" {
+			if curOverride == nil {
+				return nil, fmt.Errorf("line %d: \"glob\" is only valid inside [[overrides]]", n+1)
+			}
+			curOverride.Glob = val
+			continue
+		}
+		if err := setConfigField(cur, key, val, n+1); err != nil {
+			return nil, err
+		}
+	}
+	return pc, nil
+}
+
+func setConfigField(cfg *fmtConfig, key, val string, line int) error {
+	switch key {
+	case "tab_width":
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			return fmt.Errorf("line %d: tab_width: %v", line, err)
+		}
+		cfg.TabWidth = n
+	case "use_spaces":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("line %d: use_spaces: %v", line, err)
+		}
+		cfg.UseSpaces = b
+	case "sort_imports":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("line %d: sort_imports: %v", line, err)
+		}
+		cfg.SortImports = b
+	case "simplify":
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("line %d: simplify: %v", line, err)
+		}
+		cfg.Simplify = b
+	default:
+		return fmt.Errorf("line %d: unknown key %q", line, key)
+	}
+	return nil
+}
+
+// cacheProfile renders cfg and the active formatting mode ("plain" or
+// "imports") into a single string that uniquely identifies "what would
+// processFile produce for this source": everything the fmtCache key must
+// fold in besides the source bytes themselves, so that a -imports run
+// never reuses a plain run's cache entry (or vice versa), and two
+// directories with different .qfmt.toml profiles never poison each
+// other's entries just because a file happens to be byte-identical.
+func (cfg fmtConfig) cacheProfile(mode string) string {
+	return fmt.Sprintf("%s|tab=%d|spaces=%t|sort=%t|simplify=%t",
+		mode, cfg.TabWidth, cfg.UseSpaces, cfg.SortImports, cfg.Simplify)
+}
+
+// toFormatConfig converts a resolved fmtConfig into the format.Config
+// threaded through format.SourceWithConfig.
+func (cfg fmtConfig) toFormatConfig() format.Config {
+	return format.Config{
+		TabWidth:    cfg.TabWidth,
+		UseSpaces:   cfg.UseSpaces,
+		SortImports: cfg.SortImports,
+		Simplify:    cfg.Simplify,
+	}
+}
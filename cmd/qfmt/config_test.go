@@ -0,0 +1,79 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import "testing"
+
+func TestParseProjectConfig(t *testing.T) {
+	data := []byte(`
+tab_width = 4
+use_spaces = true
+sort_imports = true
+
+[[overrides]]
+glob = "vendor/**"
+tab_width = 2
+use_spaces = false
+`)
+	pc, err := parseProjectConfig("/proj", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := pc.resolve("/proj/main.gop")
+	if base.TabWidth != 4 || !base.UseSpaces || !base.SortImports {
+		t.Fatalf("base config mismatch: %+v", base)
+	}
+
+	vendored := pc.resolve("/proj/vendor/foo/bar.gop")
+	if vendored.TabWidth != 2 || vendored.UseSpaces {
+		t.Fatalf("override config mismatch: %+v", vendored)
+	}
+}
+
+func TestParseProjectConfigErrors(t *testing.T) {
+	cases := []string{
+		"not a key value line",
+		"glob = \"*.gop\"", // glob outside [[overrides]]
+		"tab_width = nope",
+		"unknown_key = 1",
+	}
+	for _, c := range cases {
+		if _, err := parseProjectConfig("/proj", []byte(c)); err == nil {
+			t.Errorf("parseProjectConfig(%q): expected error, got nil", c)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"vendor/**", "vendor/foo/bar.gop", true},
+		{"vendor/**", "vendor/bar.gop", true},
+		{"vendor/**", "src/bar.gop", false},
+		{"*.gop", "main.gop", true},
+		{"*.gop", "pkg/main.gop", false},
+		{"**/*.gop", "pkg/sub/main.gop", true},
+	}
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.rel); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.rel, got, c.want)
+		}
+	}
+}
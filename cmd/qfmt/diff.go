@@ -0,0 +1,212 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// diffContext is the number of unchanged lines shown around each hunk,
+// matching the default used by diff(1) and gofmt's own -d output.
+const diffContext = 3
+
+// unifiedDiff returns a unified diff between a and b, split into lines,
+// with paths a/filename and b/filename used in the file headers. It is
+// computed in-process via an LCS alignment, so qfmt never shells out to
+// an external diff tool.
+func unifiedDiff(filename string, a, b []byte) []byte {
+	aLines := splitLines(a)
+	bLines := splitLines(b)
+	ops := lcsDiff(aLines, bLines)
+	hunks := groupHunks(ops, diffContext)
+
+	var buf bytes.Buffer
+	if len(hunks) == 0 {
+		return buf.Bytes()
+	}
+	fmt.Fprintf(&buf, "--- a/%s\n", filename)
+	fmt.Fprintf(&buf, "+++ b/%s\n", filename)
+	for _, h := range hunks {
+		writeHunk(&buf, aLines, bLines, ops[h.start:h.end])
+	}
+	return buf.Bytes()
+}
+
+func splitLines(src []byte) []string {
+	if len(src) == 0 {
+		return nil
+	}
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = string(l)
+	}
+	return out
+}
+
+// opKind identifies one step of an edit script produced by lcsDiff.
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// diffOp is one aligned line: aIdx/bIdx index into the respective input
+// (-1 when not meaningful for this op kind).
+type diffOp struct {
+	kind opKind
+	aIdx int
+	bIdx int
+}
+
+// lcsDiff aligns a and b via their longest common subsequence, using
+// classic dynamic programming over line slices, and returns the
+// resulting edit script as a sequence of equal/delete/insert ops.
+func lcsDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	// dp[i][j] = length of the LCS of a[i:] and b[j:]
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				dp[i][j] = dp[i+1][j+1] + 1
+			case dp[i+1][j] >= dp[i][j+1]:
+				dp[i][j] = dp[i+1][j]
+			default:
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{opEqual, i, j})
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			ops = append(ops, diffOp{opDelete, i, -1})
+			i++
+		default:
+			ops = append(ops, diffOp{opInsert, -1, j})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		ops = append(ops, diffOp{opDelete, i, -1})
+	}
+	for ; j < m; j++ {
+		ops = append(ops, diffOp{opInsert, -1, j})
+	}
+	return ops
+}
+
+// hunk is a contiguous, context-padded range within an edit script,
+// given as [start, end) indices.
+type hunk struct {
+	start, end int
+}
+
+// groupHunks splits an edit script into hunks, keeping up to `context`
+// unchanged lines around each run of changes and merging hunks whose
+// surrounding context would otherwise overlap.
+func groupHunks(ops []diffOp, context int) []hunk {
+	var hunks []hunk
+	i := 0
+	for i < len(ops) {
+		if ops[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		start := i
+		for start > 0 && i-start < context && ops[start-1].kind == opEqual {
+			start--
+		}
+
+		end := i
+		for end < len(ops) && ops[end].kind != opEqual {
+			end++
+		}
+		trail := 0
+		for end < len(ops) && trail < context && ops[end].kind == opEqual {
+			end++
+			trail++
+		}
+
+		if n := len(hunks); n > 0 && start <= hunks[n-1].end {
+			hunks[n-1].end = end
+		} else {
+			hunks = append(hunks, hunk{start, end})
+		}
+		i = end
+	}
+	return hunks
+}
+
+// firstIdx returns the aIdx (side == 0) or bIdx (side == 1) of the first
+// op in ops that carries that side's index.
+func firstIdx(ops []diffOp, side int) int {
+	for _, op := range ops {
+		if side == 0 && op.aIdx >= 0 {
+			return op.aIdx
+		}
+		if side == 1 && op.bIdx >= 0 {
+			return op.bIdx
+		}
+	}
+	return 0
+}
+
+// writeHunk renders a single hunk in unified diff format: an
+// "@@ -l,s +l,s @@" header followed by its context/removed/added lines.
+func writeHunk(buf *bytes.Buffer, aLines, bLines []string, ops []diffOp) {
+	aStart, bStart := firstIdx(ops, 0), firstIdx(ops, 1)
+	var aCount, bCount int
+	var body bytes.Buffer
+	for _, op := range ops {
+		switch op.kind {
+		case opEqual:
+			aCount++
+			bCount++
+			body.WriteString(" ")
+			body.WriteString(aLines[op.aIdx])
+		case opDelete:
+			aCount++
+			body.WriteString("-")
+			body.WriteString(aLines[op.aIdx])
+		case opInsert:
+			bCount++
+			body.WriteString("+")
+			body.WriteString(bLines[op.bIdx])
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%d,%d +%d,%d @@\n", aStart+1, aCount, bStart+1, bCount)
+	buf.Write(body.Bytes())
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// replay reconstructs both sides of ops, so we can check lcsDiff's edit
+// script actually alternates the inputs back into a and b.
+func replay(ops []diffOp, a, b []string) (gotA, gotB []string) {
+	for _, op := range ops {
+		switch op.kind {
+		case opEqual:
+			gotA = append(gotA, a[op.aIdx])
+			gotB = append(gotB, b[op.bIdx])
+		case opDelete:
+			gotA = append(gotA, a[op.aIdx])
+		case opInsert:
+			gotB = append(gotB, b[op.bIdx])
+		}
+	}
+	return
+}
+
+func TestLcsDiff(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b []string
+	}{
+		{"identical", []string{"a", "b", "c"}, []string{"a", "b", "c"}},
+		{"empty a", nil, []string{"a", "b"}},
+		{"empty b", []string{"a", "b"}, nil},
+		{"both empty", nil, nil},
+		{"append", []string{"a", "b"}, []string{"a", "b", "c"}},
+		{"prepend", []string{"b", "c"}, []string{"a", "b", "c"}},
+		{"middle edit", []string{"a", "b", "c", "d"}, []string{"a", "x", "c", "d"}},
+		{"all different", []string{"a", "b"}, []string{"c", "d"}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ops := lcsDiff(c.a, c.b)
+			gotA, gotB := replay(ops, c.a, c.b)
+			if strings.Join(gotA, "") != strings.Join(c.a, "") {
+				t.Fatalf("replaying deletes+equals = %v, want %v", gotA, c.a)
+			}
+			if strings.Join(gotB, "") != strings.Join(c.b, "") {
+				t.Fatalf("replaying inserts+equals = %v, want %v", gotB, c.b)
+			}
+		})
+	}
+}
+
+func TestGroupHunksMergesNearbyChanges(t *testing.T) {
+	// Two single-line changes separated by fewer than 2*context equal
+	// lines should merge into a single hunk rather than producing two.
+	ops := []diffOp{
+		{opDelete, 0, -1},
+		{opEqual, 1, 0},
+		{opEqual, 2, 1},
+		{opDelete, 3, -1},
+		{opEqual, 4, 2},
+	}
+	hunks := groupHunks(ops, 3)
+	if len(hunks) != 1 {
+		t.Fatalf("groupHunks = %d hunks, want 1 (changes should have merged): %+v", len(hunks), hunks)
+	}
+	if hunks[0].start != 0 || hunks[0].end != len(ops) {
+		t.Fatalf("groupHunks = %+v, want the whole op list in one hunk", hunks[0])
+	}
+}
+
+func TestGroupHunksSplitsDistantChanges(t *testing.T) {
+	// Two changes separated by many equal lines should stay as two
+	// distinct hunks, each padded by only `context` lines.
+	ops := []diffOp{
+		{opDelete, 0, -1},
+		{opEqual, 1, 0}, {opEqual, 2, 1}, {opEqual, 3, 2}, {opEqual, 4, 3},
+		{opEqual, 5, 4}, {opEqual, 6, 5}, {opEqual, 7, 6}, {opEqual, 8, 7},
+		{opDelete, 9, -1},
+	}
+	hunks := groupHunks(ops, 1)
+	if len(hunks) != 2 {
+		t.Fatalf("groupHunks = %d hunks, want 2: %+v", len(hunks), hunks)
+	}
+}
+
+func TestGroupHunksNoChanges(t *testing.T) {
+	ops := []diffOp{{opEqual, 0, 0}, {opEqual, 1, 1}}
+	if hunks := groupHunks(ops, 3); len(hunks) != 0 {
+		t.Fatalf("groupHunks(all-equal) = %+v, want no hunks", hunks)
+	}
+}
+
+func TestUnifiedDiffNoChange(t *testing.T) {
+	src := []byte("a\nb\nc\n")
+	if diff := unifiedDiff("f.gop", src, src); len(diff) != 0 {
+		t.Fatalf("unifiedDiff(a, a) = %q, want empty", diff)
+	}
+}
+
+func TestUnifiedDiffHeadersAndHunk(t *testing.T) {
+	a := []byte("one\ntwo\nthree\n")
+	b := []byte("one\ntwo!\nthree\n")
+	diff := string(unifiedDiff("f.gop", a, b))
+
+	for _, want := range []string{
+		"--- a/f.gop\n",
+		"+++ b/f.gop\n",
+		"@@ -1,3 +1,3 @@\n",
+		"-two\n",
+		"+two!\n",
+	} {
+		if !strings.Contains(diff, want) {
+			t.Fatalf("unifiedDiff output missing %q; got:\n%s", want, diff)
+		}
+	}
+}
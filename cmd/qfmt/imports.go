@@ -0,0 +1,118 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/goplus/gop/format"
+)
+
+// organizeImports rewrites filename's import block the way goimports
+// rewrites a .go file's: dropping imports that are no longer referenced,
+// adding ones needed to resolve otherwise-unknown identifiers, and
+// sorting the result. Imports are not split into std / third-party /
+// module-local groups.
+var organizeImports = flag.Bool("imports", false, "update imports (add missing, remove unused), like goimports")
+
+var (
+	pkgIndexMu    sync.Mutex
+	pkgIndexCache = map[string]*pkgIndex{} // keyed by resolved module root
+)
+
+// pkgIndexFor returns the package index for filename's enclosing module,
+// built lazily on first use and cached per module root so repeated files
+// in the same module don't each pay to rescan GOPATH/GOMODCACHE, while a
+// run spanning more than one module (or a tree containing a nested
+// module) still resolves each file against its own module's index
+// instead of whichever module happened to be indexed first.
+func pkgIndexFor(filename string) *pkgIndex {
+	modRoot := findModRoot(filepath.Dir(filename))
+
+	pkgIndexMu.Lock()
+	idx, ok := pkgIndexCache[modRoot]
+	pkgIndexMu.Unlock()
+	if ok {
+		return idx
+	}
+
+	// An empty -cache disables the on-disk index cache as well.
+	var idxCacheDir string
+	if *cacheDir != "" {
+		idxCacheDir = filepath.Join(*cacheDir, "imports")
+	}
+	idx = newPkgIndex(idxCacheDir, modRoot)
+
+	pkgIndexMu.Lock()
+	pkgIndexCache[modRoot] = idx
+	pkgIndexMu.Unlock()
+	return idx
+}
+
+// findModRoot walks up from dir looking for the go.mod of the enclosing
+// module; it returns "" if none is found.
+func findModRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// resolveImport looks up ident in the package index, skipping Gop's
+// auto-imported builtins (gopAutoImports) and classless class-file
+// identifiers, neither of which should ever be added as an import.
+func resolveImport(idx *pkgIndex, ident string) (importPath string, ok bool) {
+	if gopAutoImports[ident] {
+		return "", false
+	}
+	candidates := idx.byIdent[ident]
+	if len(candidates) == 0 {
+		return "", false
+	}
+	// Prefer the shortest import path: it's the most likely to be the
+	// standard library or a well-known package rather than an
+	// incidental match buried in GOMODCACHE.
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if len(c.ImportPath) < len(best.ImportPath) {
+			best = c
+		}
+	}
+	return best.ImportPath, true
+}
+
+// formatImports runs qfmt's import organizer over src, under the same
+// resolved .qfmt.toml profile (configFor) that the plain formatting path
+// uses, so -imports respects a project's tab_width/simplify/etc. too.
+// For standard input, configFor resolves from the working directory,
+// whereas the plain path formats standard input with the defaults.
+func formatImports(filename string, src []byte) ([]byte, error) {
+	idx := pkgIndexFor(filename)
+	cfg := configFor(filename)
+	return format.SourceImports(src, cfg.toFormatConfig(), func(ident string) (string, bool) {
+		return resolveImport(idx, ident)
+	})
+}
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveImportSkipsGopAutoImports(t *testing.T) {
+	idx := &pkgIndex{byIdent: map[string][]pkgExport{
+		"println": {{Ident: "println", ImportPath: "some/pkg", PkgName: "pkg"}},
+	}}
+	if _, ok := resolveImport(idx, "println"); ok {
+		t.Error("resolveImport(\"println\") should never resolve: it's a Gop auto-import builtin")
+	}
+}
+
+func TestResolveImportPrefersShortestPath(t *testing.T) {
+	idx := &pkgIndex{byIdent: map[string][]pkgExport{
+		"Foo": {
+			{Ident: "Foo", ImportPath: "some/deeply/nested/pkg", PkgName: "pkg"},
+			{Ident: "Foo", ImportPath: "short", PkgName: "short"},
+		},
+	}}
+	path, ok := resolveImport(idx, "Foo")
+	if !ok || path != "short" {
+		t.Errorf("resolveImport(\"Foo\") = (%q, %v), want (\"short\", true)", path, ok)
+	}
+}
+
+func TestResolveImportUnknownIdent(t *testing.T) {
+	idx := &pkgIndex{byIdent: map[string][]pkgExport{}}
+	if _, ok := resolveImport(idx, "Unknown"); ok {
+		t.Error("resolveImport(\"Unknown\") should report ok=false when nothing exports it")
+	}
+}
+
+func TestPkgIndexForCachesPerModuleRoot(t *testing.T) {
+	// Reset shared state so this test doesn't depend on others having
+	// already populated it.
+	pkgIndexMu.Lock()
+	pkgIndexCache = map[string]*pkgIndex{}
+	pkgIndexMu.Unlock()
+
+	modA := t.TempDir()
+	writeFile(t, modA, "go.mod", "module a\n")
+	modB := t.TempDir()
+	writeFile(t, modB, "go.mod", "module b\n")
+
+	idxA1 := pkgIndexFor(filepath.Join(modA, "x.gop"))
+	idxB := pkgIndexFor(filepath.Join(modB, "y.gop"))
+	idxA2 := pkgIndexFor(filepath.Join(modA, "z.gop"))
+
+	if idxA1 != idxA2 {
+		t.Error("pkgIndexFor should return the same cached index for two files in the same module")
+	}
+	if idxA1 == idxB {
+		t.Error("pkgIndexFor should not share an index between two different modules")
+	}
+}
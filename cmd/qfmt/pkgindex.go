@@ -0,0 +1,273 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// pkgExport is one exported identifier found while indexing a package
+// directory, together with the import path and package name that
+// provide it.
+type pkgExport struct {
+	Ident      string
+	ImportPath string
+	PkgName    string
+}
+
+// pkgIndex maps an unresolved identifier (e.g. "Sprintf") to the
+// packages that export it, so the import organizer can decide what to
+// add to a file's import block.
+type pkgIndex struct {
+	byIdent map[string][]pkgExport
+}
+
+// gopAutoImports are identifiers Gop makes available without an explicit
+// import (classless "class file" builtins and the Gop builtin package);
+// the import organizer must never treat these as unresolved or unused.
+var gopAutoImports = map[string]bool{
+	"println":   true,
+	"print":     true,
+	"panic":     true,
+	"recover":   true,
+	"exit":      true,
+	"gopanic":   true,
+	"gorecover": true,
+}
+
+// newPkgIndex builds a package index by scanning GOPATH, GOMODCACHE and
+// modRoot (the current module), caching the per-directory scan on disk
+// under cacheDir keyed by each directory's mtime so unchanged packages
+// are never reparsed.
+func newPkgIndex(cacheDir, modRoot string) *pkgIndex {
+	idx := &pkgIndex{byIdent: make(map[string][]pkgExport)}
+	for _, root := range searchRoots(modRoot) {
+		idx.scanTree(root, cacheDir)
+	}
+	return idx
+}
+
+func searchRoots(modRoot string) []string {
+	var roots []string
+	if modRoot != "" {
+		roots = append(roots, modRoot)
+	}
+	if gp := os.Getenv("GOPATH"); gp != "" {
+		for _, p := range filepath.SplitList(gp) {
+			roots = append(roots, filepath.Join(p, "src"))
+		}
+	}
+	if gmc := os.Getenv("GOMODCACHE"); gmc != "" {
+		roots = append(roots, gmc)
+	} else if gp := os.Getenv("GOPATH"); gp != "" {
+		roots = append(roots, filepath.Join(gp, "pkg", "mod"))
+	}
+	return roots
+}
+
+// dirCacheEntry is the on-disk, per-directory cache record: the
+// directory's mtime at scan time plus the exports it produced.
+type dirCacheEntry struct {
+	ModTime int64
+	Exports []pkgExport
+}
+
+func (idx *pkgIndex) scanTree(root, cacheDir string) {
+	filepath.Walk(root, func(dir string, fi os.FileInfo, err error) error {
+		if err != nil || !fi.IsDir() {
+			return nil
+		}
+		if dir != root && (strings.HasPrefix(fi.Name(), ".") || fi.Name() == "testdata") {
+			return filepath.SkipDir
+		}
+		exports, ok := idx.loadCached(dir, cacheDir, fi)
+		if !ok {
+			exports = scanDirExports(dir)
+			idx.storeCached(dir, cacheDir, fi, exports)
+		}
+		for _, e := range exports {
+			idx.byIdent[e.Ident] = append(idx.byIdent[e.Ident], e)
+		}
+		return nil
+	})
+}
+
+func cacheKeyFor(dir string) string {
+	return strings.NewReplacer("/", "_", string(filepath.Separator), "_", ":", "_").Replace(dir) + ".json"
+}
+
+func (idx *pkgIndex) loadCached(dir, cacheDir string, fi os.FileInfo) ([]pkgExport, bool) {
+	if cacheDir == "" {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(filepath.Join(cacheDir, "pkgindex", cacheKeyFor(dir)))
+	if err != nil {
+		return nil, false
+	}
+	var entry dirCacheEntry
+	if json.Unmarshal(data, &entry) != nil {
+		return nil, false
+	}
+	if entry.ModTime != fi.ModTime().Unix() {
+		return nil, false
+	}
+	return entry.Exports, true
+}
+
+func (idx *pkgIndex) storeCached(dir, cacheDir string, fi os.FileInfo, exports []pkgExport) {
+	if cacheDir == "" {
+		return
+	}
+	sub := filepath.Join(cacheDir, "pkgindex")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		return
+	}
+	data, err := json.Marshal(dirCacheEntry{ModTime: fi.ModTime().Unix(), Exports: exports})
+	if err != nil {
+		return
+	}
+	ioutil.WriteFile(filepath.Join(sub, cacheKeyFor(dir)), data, 0644)
+}
+
+// scanDirExports returns the exported top-level identifiers of the
+// package directory dir. .go files are parsed with go/parser directly.
+// .gop files are also run through go/parser: most non-classless Gop
+// source is a syntactic superset of Go that go/parser accepts as-is. A
+// classless class file (one with no "package" clause) is retried with
+// a synthetic "package <dir>" line prepended, matching how such files
+// are compiled into the enclosing directory's package. Anything go/parser
+// still can't make sense of (genuinely Gop-only syntax, such as
+// command-style calls) is skipped rather than guessed at.
+func scanDirExports(dir string) []pkgExport {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	importPath := dir
+	dirPkgName := filepath.Base(dir)
+	var exports []pkgExport
+	fset := token.NewFileSet()
+	for _, fi := range entries {
+		name := fi.Name()
+		switch {
+		case strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go"):
+			f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+			if err != nil {
+				continue
+			}
+			exports = append(exports, declExports(f, importPath)...)
+		case strings.HasSuffix(name, ".gop"):
+			f := parseGopFile(fset, filepath.Join(dir, name), dirPkgName)
+			if f == nil {
+				continue
+			}
+			exports = append(exports, declExports(f, importPath)...)
+		}
+	}
+	return exports
+}
+
+func declExports(f *ast.File, importPath string) []pkgExport {
+	var exports []pkgExport
+	for _, decl := range f.Decls {
+		for _, id := range exportedIdents(decl) {
+			exports = append(exports, pkgExport{Ident: id, ImportPath: importPath, PkgName: f.Name.Name})
+		}
+	}
+	return exports
+}
+
+// parseGopFile parses a .gop file's declarations, falling back to
+// treating it as a classless class file (no package clause) of package
+// dirPkgName when a plain parse fails. It returns nil if neither parse
+// succeeds.
+func parseGopFile(fset *token.FileSet, path, dirPkgName string) *ast.File {
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	if f, err := parser.ParseFile(fset, path, src, 0); err == nil {
+		return f
+	}
+	synthetic := append([]byte("package "+sanitizePkgName(dirPkgName)+"\n"), src...)
+	f, err := parser.ParseFile(fset, path, synthetic, 0)
+	if err != nil {
+		return nil
+	}
+	return f
+}
+
+// sanitizePkgName turns name into a valid Go package identifier:
+// directory names, unlike real package names, aren't guaranteed to
+// already be one (they may start with a digit or contain characters
+// like "-"), but the synthetic "package X" line parseGopFile prepends
+// must parse.
+func sanitizePkgName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+			b.WriteRune(r)
+		case unicode.IsDigit(r):
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "_"
+	}
+	return b.String()
+}
+
+func exportedIdents(decl ast.Decl) []string {
+	var names []string
+	switch d := decl.(type) {
+	case *ast.GenDecl:
+		for _, spec := range d.Specs {
+			switch s := spec.(type) {
+			case *ast.ValueSpec:
+				for _, n := range s.Names {
+					if n.IsExported() {
+						names = append(names, n.Name)
+					}
+				}
+			case *ast.TypeSpec:
+				if s.Name.IsExported() {
+					names = append(names, s.Name.Name)
+				}
+			}
+		}
+	case *ast.FuncDecl:
+		if d.Recv == nil && d.Name.IsExported() {
+			names = append(names, d.Name.Name)
+		}
+	}
+	return names
+}
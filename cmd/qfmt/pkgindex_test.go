@@ -0,0 +1,119 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestScanDirExportsGoFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "a.go", "package foo\n\nfunc Bar() int { return 1 }\n\nfunc unexported() {}\n")
+
+	exports := scanDirExports(dir)
+	idents := make(map[string]bool)
+	for _, e := range exports {
+		idents[e.Ident] = true
+		if e.PkgName != "foo" {
+			t.Errorf("export %+v: PkgName = %q, want %q", e, e.PkgName, "foo")
+		}
+	}
+	if !idents["Bar"] {
+		t.Errorf("scanDirExports(%q) = %+v, want it to include exported Bar", dir, exports)
+	}
+	if idents["unexported"] {
+		t.Errorf("scanDirExports(%q) = %+v, should not include unexported", dir, exports)
+	}
+}
+
+func TestScanDirExportsGopClassless(t *testing.T) {
+	dir := t.TempDir()
+	// A classless .gop class file has no package clause at all.
+	writeFile(t, dir, "classless.gop", "func Foo() int {\n\treturn 1\n}\n")
+
+	exports := scanDirExports(dir)
+	var found bool
+	for _, e := range exports {
+		if e.Ident == "Foo" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("scanDirExports(%q) = %+v, want it to index the classless .gop file's Foo via the synthetic-package fallback", dir, exports)
+	}
+}
+
+func TestScanDirExportsGopClasslessDirNameNeedsSanitizing(t *testing.T) {
+	// t.TempDir() often has a purely numeric base name, which isn't a
+	// valid Go package identifier; the synthetic "package X" fallback
+	// must still parse.
+	dir := t.TempDir()
+	writeFile(t, dir, "classless.gop", "func Foo() int {\n\treturn 1\n}\n")
+
+	exports := scanDirExports(dir)
+	for _, e := range exports {
+		if e.Ident == "Foo" {
+			return
+		}
+	}
+	t.Errorf("scanDirExports(%q) = %+v, want Foo indexed even though the directory name %q isn't a valid identifier", dir, exports, filepath.Base(dir))
+}
+
+func TestScanDirExportsGopWithPackageClause(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "normal.gop", "package foo\n\nfunc Bar() int { return 1 }\n")
+
+	exports := scanDirExports(dir)
+	var found bool
+	for _, e := range exports {
+		if e.Ident == "Bar" && e.PkgName == "foo" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("scanDirExports(%q) = %+v, want Bar indexed directly (no synthetic fallback needed)", dir, exports)
+	}
+}
+
+func TestScanDirExportsSkipsUnparseableGopSyntax(t *testing.T) {
+	dir := t.TempDir()
+	// Genuinely Gop-only syntax (command-style call) that go/parser can't
+	// make sense of even with the synthetic-package retry; it must be
+	// skipped rather than causing scanDirExports to fail entirely.
+	writeFile(t, dir, "cmdstyle.gop", "println \"hi\"\n")
+	writeFile(t, dir, "ok.gop", "func Ok() int { return 1 }\n")
+
+	exports := scanDirExports(dir)
+	var foundOk bool
+	for _, e := range exports {
+		if e.Ident == "Ok" {
+			foundOk = true
+		}
+	}
+	if !foundOk {
+		t.Errorf("scanDirExports(%q) = %+v, want Ok indexed even though a sibling file couldn't be parsed", dir, exports)
+	}
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"go/printer"
@@ -14,14 +15,21 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/goplus/gop/format"
 )
 
 var (
 	// main operation modes
-	write = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	write    = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	cacheDir = flag.String("cache", defaultCacheDir(), "directory used to cache already-formatted files (disable with -cache=)")
+	parallel = flag.Int("p", runtime.NumCPU(), "number of files to format in parallel")
+	list     = flag.Bool("l", false, "list files whose formatting differs from qfmt's")
+	doDiff   = flag.Bool("d", false, "display diffs of formatting changes")
+	check    = flag.Bool("check", false, "like -l, but also exit with a non-zero status if any file is not formatted (for CI)")
 )
 
 const (
@@ -34,6 +42,20 @@ var (
 	exitCode = 0
 )
 
+var cache *fmtCache
+
+// exitMu guards exitCode, which is now written from multiple worker
+// goroutines in walkDir.
+var exitMu sync.Mutex
+
+func setExitCode(code int) {
+	exitMu.Lock()
+	if code > exitCode {
+		exitCode = code
+	}
+	exitMu.Unlock()
+}
+
 func isGopFile(f os.FileInfo) bool {
 	// ignore non-Gop files
 	name := f.Name()
@@ -42,19 +64,7 @@ func isGopFile(f os.FileInfo) bool {
 
 func report(err error) {
 	scanner.PrintError(os.Stderr, err)
-	exitCode = 2
-}
-
-func visitFile(path string, f os.FileInfo, err error) error {
-	if err == nil && isGopFile(f) {
-		err = processFile(path, nil, os.Stdout, false)
-	}
-	// Don't complain if a file was deleted in the meantime (i.e.
-	// the directory changed concurrently while running gofmt).
-	if err != nil && !os.IsNotExist(err) {
-		report(err)
-	}
-	return nil
+	setExitCode(2)
 }
 
 const chmodSupported = runtime.GOOS != "windows"
@@ -87,6 +97,50 @@ func backupFile(filename string, data []byte, perm os.FileMode) (string, error)
 	return backupName, err
 }
 
+// writeFormatted replaces filename's contents with res, keeping a backup
+// of src (the original contents) until the replacement is safely in
+// place. The replacement itself is atomic: res is written to a temporary
+// file in the same directory and then renamed over filename, so readers
+// never observe a partially written file.
+func writeFormatted(filename string, src, res []byte, perm os.FileMode) error {
+	backupName, err := backupFile(filename+".", src, perm)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename))
+	if err != nil {
+		os.Remove(backupName)
+		return err
+	}
+	tmpName := tmp.Name()
+	if chmodSupported {
+		if err = tmp.Chmod(perm); err != nil {
+			tmp.Close()
+			os.Remove(tmpName)
+			os.Remove(backupName)
+			return err
+		}
+	}
+	_, err = tmp.Write(res)
+	if err1 := tmp.Close(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		os.Remove(backupName)
+		return err
+	}
+
+	if err = os.Rename(tmpName, filename); err != nil {
+		os.Remove(tmpName)
+		os.Rename(backupName, filename)
+		return err
+	}
+
+	return os.Remove(backupName)
+}
+
 // If in == nil, the source is the contents of the file with the given filename.
 func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error {
 	var perm os.FileMode = 0644
@@ -109,38 +163,136 @@ func processFile(filename string, in io.Reader, out io.Writer, stdin bool) error
 		return err
 	}
 
-	res, err := format.Source(src)
+	mode := "plain"
+	cfg := defaultFmtConfig
+	if *organizeImports {
+		mode = "imports"
+	}
+	// formatImports resolves its config from filename even for standard
+	// input, so the cache profile must be built from the same config.
+	if !stdin || *organizeImports {
+		cfg = configFor(filename)
+	}
+	profile := cfg.cacheProfile(mode)
+
+	if cache.alreadyFormatted(src, profile) {
+		if !*list && !*write && !*doDiff {
+			_, err = out.Write(src)
+		}
+		return err
+	}
+
+	var res []byte
+	switch {
+	case *organizeImports:
+		res, err = formatImports(filename, src)
+	case !stdin:
+		res, err = format.SourceWithConfig(src, cfg.toFormatConfig())
+	default:
+		res, err = format.Source(src)
+	}
 	if err != nil {
 		return err
 	}
 
-	if *write && string(src) != string(res) {
-		exitCode = 1
-		// make a temporary backup before overwriting original
-		backupName, err := backupFile(filename+".", src, perm)
-		if err != nil {
-			return err
+	if string(src) == string(res) {
+		cache.markFormatted(src, profile)
+	}
+
+	if !bytes.Equal(src, res) {
+		if *list {
+			fmt.Fprintln(out, filename)
+			if *check {
+				setExitCode(1)
+			}
 		}
-		err = ioutil.WriteFile(filename, res, perm)
-		if err != nil {
-			os.Rename(backupName, filename)
-			return err
+		if *write {
+			setExitCode(1)
+			if err = writeFormatted(filename, src, res, perm); err != nil {
+				return err
+			}
 		}
-		err = os.Remove(backupName)
-		if err != nil {
-			return err
+		if *doDiff {
+			setExitCode(1)
+			out.Write(unifiedDiff(filename, src, res))
 		}
 	}
 
-	if !*write {
+	if !*list && !*write && !*doDiff {
 		_, err = out.Write(res)
 	}
 
 	return err
 }
 
+// fileResult is one file's outcome from the worker pool in walkDir: the
+// formatted output (when not writing in place) plus any error.
+type fileResult struct {
+	path string
+	out  []byte
+	err  error
+}
+
+// walkDir formats every .gop file under path using a bounded pool of
+// worker goroutines (sized by -p), then prints results in a stable,
+// path-sorted order regardless of the order in which workers finished.
 func walkDir(path string) {
-	filepath.Walk(path, visitFile)
+	numWorkers := *parallel
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	paths := make(chan string, numWorkers)
+	results := make(chan fileResult, numWorkers)
+
+	var workers sync.WaitGroup
+	workers.Add(numWorkers)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer workers.Done()
+			for p := range paths {
+				var buf bytes.Buffer
+				err := processFile(p, nil, &buf, false)
+				results <- fileResult{path: p, out: buf.Bytes(), err: err}
+			}
+		}()
+	}
+
+	go func() {
+		filepath.Walk(path, func(p string, f os.FileInfo, err error) error {
+			switch {
+			case err != nil:
+				if !os.IsNotExist(err) {
+					results <- fileResult{path: p, err: err}
+				}
+			case isGopFile(f):
+				paths <- p
+			}
+			return nil
+		})
+		close(paths)
+	}()
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	collected := make([]fileResult, 0, 64)
+	for r := range results {
+		collected = append(collected, r)
+	}
+	sort.Slice(collected, func(i, j int) bool { return collected[i].path < collected[j].path })
+
+	for _, r := range collected {
+		if r.err != nil {
+			report(r.err)
+			continue
+		}
+		if !*write && len(r.out) > 0 {
+			os.Stdout.Write(r.out)
+		}
+	}
 }
 
 func usage() {
@@ -160,6 +312,20 @@ func qfmtMain() {
 	flag.Usage = usage
 	flag.Parse()
 
+	if *check {
+		*list = true
+	}
+
+	cache = newFmtCache(*cacheDir)
+	cache.evict()
+
+	if *serverMode {
+		if err := runServer(os.Stdin, os.Stdout); err != nil {
+			report(err)
+		}
+		return
+	}
+
 	narg := flag.NArg()
 	if narg == 0 {
 		if *write {
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"go/scanner"
+	"io"
+
+	"github.com/goplus/gop/format"
+)
+
+// serverMode keeps qfmt alive across many requests, so editor
+// integrations pay the process-startup cost once instead of on every
+// format-on-save keystroke.
+var serverMode = flag.Bool("server", false, "read length-prefixed JSON format requests from stdin and write responses to stdout, without exiting")
+
+// serverRequest is one length-prefixed request in the -server protocol.
+// Type defaults to "format" when omitted.
+type serverRequest struct {
+	Type     string `json:"type,omitempty"`
+	Filename string `json:"filename,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// serverResponse is one length-prefixed response in the -server
+// protocol, matching the request that produced it one-for-one.
+type serverResponse struct {
+	Type      string        `json:"type,omitempty"`
+	Formatted string        `json:"formatted,omitempty"`
+	Errors    []serverError `json:"errors,omitempty"`
+}
+
+// serverError is a structured formatting error: a source position plus
+// message, in place of qfmt's normal scanner.PrintError stderr dump.
+type serverError struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+}
+
+// runServer implements -server: it reads requests until stdin closes or
+// a "shutdown" request arrives, formatting each "format" request (the
+// default when Type is omitted) and answering "ping" with "pong".
+func runServer(in io.Reader, out io.Writer) error {
+	for {
+		frame, err := readFrame(in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req serverRequest
+		if err := json.Unmarshal(frame, &req); err != nil {
+			if werr := writeResponse(out, serverResponse{
+				Errors: []serverError{{Message: "invalid request: " + err.Error()}},
+			}); werr != nil {
+				return werr
+			}
+			continue
+		}
+
+		switch req.Type {
+		case "ping":
+			if err := writeResponse(out, serverResponse{Type: "pong"}); err != nil {
+				return err
+			}
+		case "shutdown":
+			return writeResponse(out, serverResponse{Type: "shutdown"})
+		default:
+			resp := formatRequest(req)
+			if err := writeResponse(out, resp); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func formatRequest(req serverRequest) serverResponse {
+	src := []byte(req.Content)
+	var res []byte
+	var err error
+	if req.Filename != "" {
+		res, err = format.SourceWithConfig(src, configFor(req.Filename).toFormatConfig())
+	} else {
+		res, err = format.Source(src)
+	}
+	if err != nil {
+		return serverResponse{Type: "formatted", Errors: toServerErrors(err)}
+	}
+	return serverResponse{Type: "formatted", Formatted: string(res)}
+}
+
+// toServerErrors converts a format.Source/format.SourceWithConfig error
+// into structured line/column errors. scanner.ErrorList and the single
+// scanner.Error it wraps both carry a token.Position; anything else is
+// reported with just a message.
+func toServerErrors(err error) []serverError {
+	var list scanner.ErrorList
+	if errors.As(err, &list) {
+		errs := make([]serverError, len(list))
+		for i, e := range list {
+			errs[i] = serverError{Line: e.Pos.Line, Column: e.Pos.Column, Message: e.Msg}
+		}
+		return errs
+	}
+	var single scanner.Error
+	if errors.As(err, &single) {
+		return []serverError{{Line: single.Pos.Line, Column: single.Pos.Column, Message: single.Msg}}
+	}
+	return []serverError{{Message: err.Error()}}
+}
+
+// readFrame reads one length-prefixed message: a 4-byte big-endian
+// length followed by that many bytes of JSON.
+func readFrame(r io.Reader) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(length[:])
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// writeFrame writes one length-prefixed message: data, preceded by its
+// 4-byte big-endian length.
+func writeFrame(w io.Writer, data []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(data)))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func writeResponse(w io.Writer, resp serverResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return writeFrame(w, data)
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package format implements standard formatting of Gop source.
+package format
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+)
+
+const defaultTabWidth = 8
+
+// Config is a formatting profile, as loaded from a project's .qfmt.toml:
+// the go/printer knobs plus the higher-level options (SortImports,
+// Simplify) qfmt layers on top of it.
+type Config struct {
+	TabWidth    int
+	UseSpaces   bool
+	SortImports bool
+	Simplify    bool
+}
+
+// DefaultConfig is qfmt's built-in formatting profile, used when no
+// .qfmt.toml applies.
+var DefaultConfig = Config{TabWidth: defaultTabWidth, UseSpaces: true}
+
+// Source formats src in qfmt's default style.
+func Source(src []byte) ([]byte, error) {
+	return SourceWithConfig(src, DefaultConfig)
+}
+
+// SourceWithConfig formats src the way Source does, but using the
+// go/printer settings resolved from cfg instead of qfmt's built-in
+// defaults.
+func SourceWithConfig(src []byte, cfg Config) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parseSource(fset, src)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Simplify {
+		simplify(fset, f)
+	}
+	if cfg.SortImports {
+		ast.SortImports(fset, f)
+	}
+	return printSource(fset, f, cfg.printerConfig())
+}
+
+func (cfg Config) printerConfig() printer.Config {
+	mode := printer.TabIndent
+	if cfg.UseSpaces {
+		mode |= printer.UseSpaces
+	}
+	tabWidth := cfg.TabWidth
+	if tabWidth <= 0 {
+		tabWidth = defaultTabWidth
+	}
+	return printer.Config{Mode: mode, Tabwidth: tabWidth}
+}
+
+func parseSource(fset *token.FileSet, src []byte) (*ast.File, error) {
+	return parser.ParseFile(fset, "", src, parser.ParseComments)
+}
+
+func printSource(fset *token.FileSet, f *ast.File, cfg printer.Config) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := cfg.Fprint(&buf, fset, f); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
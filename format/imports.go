@@ -0,0 +1,198 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package format
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+)
+
+// predeclared holds the universe-scope identifiers (builtin functions
+// and types) that are never unresolved imports, no matter how they're
+// used.
+var predeclared = map[string]bool{
+	"append": true, "cap": true, "close": true, "complex": true,
+	"copy": true, "delete": true, "imag": true, "len": true,
+	"make": true, "new": true, "panic": true, "print": true,
+	"println": true, "real": true, "recover": true,
+	"true": true, "false": true, "iota": true, "nil": true,
+	"bool": true, "byte": true, "complex64": true, "complex128": true,
+	"error": true, "float32": true, "float64": true, "int": true,
+	"int8": true, "int16": true, "int32": true, "int64": true,
+	"rune": true, "string": true, "uint": true, "uint8": true,
+	"uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+}
+
+// SourceImports rewrites src's import block the way goimports rewrites
+// a .go file's: unused imports are dropped, and an import is added for
+// every unqualified call whose name resolve can map to an import path.
+// resolve is consulted for Gop-style bare calls (e.g. a classless class
+// file's auto-imported builtins): calls already qualified with a known
+// package (pkg.Func) are left untouched. cfg's printer settings and
+// Simplify apply the same way they do for SourceWithConfig, so a tree
+// with a .qfmt.toml gets consistent output from either entry point;
+// imports are always sorted, whether or not cfg.SortImports is set.
+func SourceImports(src []byte, cfg Config, resolve func(ident string) (importPath string, ok bool)) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parseSource(fset, src)
+	if err != nil {
+		return nil, err
+	}
+
+	removeUnusedImports(f)
+	addMissingImports(f, resolve)
+	if cfg.Simplify {
+		simplify(fset, f)
+	}
+	ast.SortImports(fset, f)
+
+	return printSource(fset, f, cfg.printerConfig())
+}
+
+// removeUnusedImports drops every non-blank, non-dot import whose local
+// name is never used as a selector qualifier in f.
+func removeUnusedImports(f *ast.File) {
+	used := usedQualifiers(f)
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.IMPORT {
+			continue
+		}
+		specs := gd.Specs[:0]
+		for _, spec := range gd.Specs {
+			imp := spec.(*ast.ImportSpec)
+			name := importLocalName(imp)
+			if name == "_" || name == "." || used[name] {
+				specs = append(specs, spec)
+			}
+		}
+		gd.Specs = specs
+	}
+}
+
+// usedQualifiers returns the set of identifiers used as the package
+// qualifier of a selector expression (pkg.Sel) anywhere in f.
+func usedQualifiers(f *ast.File) map[string]bool {
+	used := make(map[string]bool)
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok {
+			used[id.Name] = true
+		}
+		return true
+	})
+	return used
+}
+
+// addMissingImports finds unqualified calls (Fun()) whose name isn't
+// declared anywhere in the file and resolves them against resolve,
+// adding whatever import it names if it isn't already present.
+func addMissingImports(f *ast.File, resolve func(string) (string, bool)) {
+	if resolve == nil {
+		return
+	}
+	existing := existingImportPaths(f)
+	missing := make(map[string]bool)
+
+	ast.Inspect(f, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		id, ok := call.Fun.(*ast.Ident)
+		if !ok || id.Obj != nil || predeclared[id.Name] {
+			return true
+		}
+		path, ok := resolve(id.Name)
+		if !ok || existing[path] || missing[path] {
+			return true
+		}
+		missing[path] = true
+		return true
+	})
+
+	if len(missing) == 0 {
+		return
+	}
+	decl := importDecl(f)
+	// Every node needs a position fset can resolve, or ast.SortImports
+	// (and the printer after it) panics trying to look up its line
+	// number. f.Pos() (the "package" keyword) is always valid and, being
+	// before any real import, sorts harmlessly alongside them.
+	pos := f.Pos()
+	for path := range missing {
+		decl.Specs = append(decl.Specs, &ast.ImportSpec{
+			Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(path), ValuePos: pos},
+		})
+	}
+	// A multi-spec import declaration must be parenthesized.
+	if len(decl.Specs) > 1 && decl.Lparen == token.NoPos {
+		decl.Lparen = pos
+		decl.Rparen = pos
+	}
+}
+
+func existingImportPaths(f *ast.File) map[string]bool {
+	paths := make(map[string]bool)
+	for _, imp := range f.Imports {
+		path, err := strconv.Unquote(imp.Path.Value)
+		if err == nil {
+			paths[path] = true
+		}
+	}
+	return paths
+}
+
+func importLocalName(imp *ast.ImportSpec) string {
+	if imp.Name != nil {
+		return imp.Name.Name
+	}
+	path, err := strconv.Unquote(imp.Path.Value)
+	if err != nil {
+		return ""
+	}
+	if i := lastSlash(path); i >= 0 {
+		return path[i+1:]
+	}
+	return path
+}
+
+func lastSlash(s string) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == '/' {
+			return i
+		}
+	}
+	return -1
+}
+
+// importDecl returns f's first import declaration, creating and
+// prepending an empty one if it has none.
+func importDecl(f *ast.File) *ast.GenDecl {
+	for _, decl := range f.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			return gd
+		}
+	}
+	gd := &ast.GenDecl{TokPos: f.Pos(), Tok: token.IMPORT, Lparen: token.NoPos}
+	f.Decls = append([]ast.Decl{gd}, f.Decls...)
+	return gd
+}
@@ -0,0 +1,101 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func resolveMap(m map[string]string) func(string) (string, bool) {
+	return func(ident string) (string, bool) {
+		path, ok := m[ident]
+		return path, ok
+	}
+}
+
+func TestSourceImportsAddsToFileWithNoImports(t *testing.T) {
+	src := []byte("package p\n\nfunc f() {\n\tfoo()\n\tbar()\n\tbaz()\n}\n")
+	resolve := resolveMap(map[string]string{"foo": "a/foo", "bar": "b/bar", "baz": "c/baz"})
+
+	out, err := SourceImports(src, DefaultConfig, resolve)
+	if err != nil {
+		t.Fatalf("SourceImports: %v", err)
+	}
+	got := string(out)
+	for _, want := range []string{`"a/foo"`, `"b/bar"`, `"c/baz"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output missing import %s; got:\n%s", want, got)
+		}
+	}
+}
+
+func TestSourceImportsAddsSingleToFileWithNoImports(t *testing.T) {
+	src := []byte("package p\n\nfunc f() {\n\tfoo()\n}\n")
+	resolve := resolveMap(map[string]string{"foo": "a/foo"})
+
+	out, err := SourceImports(src, DefaultConfig, resolve)
+	if err != nil {
+		t.Fatalf("SourceImports: %v", err)
+	}
+	if !strings.Contains(string(out), `import "a/foo"`) {
+		t.Errorf("expected an unparenthesized single import, got:\n%s", out)
+	}
+}
+
+func TestSourceImportsAddsToExistingUnparenthesizedImport(t *testing.T) {
+	src := []byte("package p\n\nimport \"fmt\"\n\nfunc f() {\n\tfmt.Println(\"x\")\n\tbar()\n}\n")
+	resolve := resolveMap(map[string]string{"bar": "b/bar"})
+
+	out, err := SourceImports(src, DefaultConfig, resolve)
+	if err != nil {
+		t.Fatalf("SourceImports: %v", err)
+	}
+	got := string(out)
+	if !strings.Contains(got, `"b/bar"`) || !strings.Contains(got, `"fmt"`) {
+		t.Errorf("expected both imports present, got:\n%s", got)
+	}
+}
+
+func TestSourceImportsRemovesUnused(t *testing.T) {
+	src := []byte("package p\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc f() {\n\tfmt.Println(\"x\")\n}\n")
+
+	out, err := SourceImports(src, DefaultConfig, nil)
+	if err != nil {
+		t.Fatalf("SourceImports: %v", err)
+	}
+	got := string(out)
+	if strings.Contains(got, `"os"`) {
+		t.Errorf("unused import \"os\" should have been removed, got:\n%s", got)
+	}
+	if !strings.Contains(got, `"fmt"`) {
+		t.Errorf("used import \"fmt\" should have been kept, got:\n%s", got)
+	}
+}
+
+func TestSourceImportsLeavesBlankAndDotImports(t *testing.T) {
+	src := []byte("package p\n\nimport (\n\t_ \"a/blank\"\n\t. \"b/dot\"\n)\n\nfunc f() {}\n")
+
+	out, err := SourceImports(src, DefaultConfig, nil)
+	if err != nil {
+		t.Fatalf("SourceImports: %v", err)
+	}
+	got := string(out)
+	if !strings.Contains(got, `_ "a/blank"`) || !strings.Contains(got, `. "b/dot"`) {
+		t.Errorf("blank/dot imports should never be dropped as unused, got:\n%s", got)
+	}
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package format
+
+import (
+	"bytes"
+	"go/ast"
+	"go/printer"
+	"go/token"
+)
+
+// simplify rewrites f the way "gofmt -s" does, covering its two most
+// common rewrites: eliding a composite literal element's type when it
+// repeats the type the enclosing array/slice/map literal already names,
+// and dropping blank identifiers from a range statement's key/value.
+// More exotic gofmt -s rewrites aren't implemented.
+func simplify(fset *token.FileSet, f *ast.File) {
+	ast.Walk(simplifier{fset}, f)
+}
+
+type simplifier struct {
+	fset *token.FileSet
+}
+
+func (s simplifier) Visit(node ast.Node) ast.Visitor {
+	switch n := node.(type) {
+	case *ast.CompositeLit:
+		var eltType ast.Expr
+		switch typ := n.Type.(type) {
+		case *ast.ArrayType:
+			eltType = typ.Elt
+		case *ast.MapType:
+			eltType = typ.Value
+		}
+		if eltType == nil {
+			return s
+		}
+		for _, elt := range n.Elts {
+			x := elt
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				x = kv.Value
+			}
+			ast.Walk(s, x)
+			if inner, ok := x.(*ast.CompositeLit); ok && inner.Type != nil && s.sameType(inner.Type, eltType) {
+				inner.Type = nil
+			}
+		}
+		// The literal was simplified directly; no need to walk into it again.
+		return nil
+	case *ast.RangeStmt:
+		if isBlank(n.Value) {
+			n.Value = nil
+		}
+		if isBlank(n.Key) && n.Value == nil {
+			n.Key = nil
+		}
+	}
+	return s
+}
+
+func isBlank(x ast.Expr) bool {
+	ident, ok := x.(*ast.Ident)
+	return ok && ident.Name == "_"
+}
+
+// sameType reports whether a and b are the same type expression. Go's
+// type exprs don't have a cheap structural-equality check, so this
+// renders both through go/printer and compares the resulting text —
+// good enough to decide whether a composite literal's element type is
+// redundant.
+func (s simplifier) sameType(a, b ast.Expr) bool {
+	return s.render(a) == s.render(b)
+}
+
+func (s simplifier) render(x ast.Expr) string {
+	var buf bytes.Buffer
+	if (&printer.Config{}).Fprint(&buf, s.fset, x) != nil {
+		return ""
+	}
+	return buf.String()
+}
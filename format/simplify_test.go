@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2021 The GoPlus Authors (goplus.org). All rights reserved.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package format
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSourceWithConfigSimplifyElidesCompositeLitTypes(t *testing.T) {
+	src := []byte("package p\n\nvar v = []int{0, 1, 2}\nvar m = [][]int{[]int{1}, []int{2}}\n")
+
+	cfg := DefaultConfig
+	cfg.Simplify = true
+	out, err := SourceWithConfig(src, cfg)
+	if err != nil {
+		t.Fatalf("SourceWithConfig: %v", err)
+	}
+	got := string(out)
+	if strings.Contains(got, "[]int{1}") || strings.Contains(got, "[]int{2}") {
+		t.Errorf("simplify should have elided the redundant []int element types, got:\n%s", got)
+	}
+	if !strings.Contains(got, "{1}") || !strings.Contains(got, "{2}") {
+		t.Errorf("expected simplified elements {1} and {2}, got:\n%s", got)
+	}
+}
+
+func TestSourceWithConfigSimplifyOffLeavesCompositeLitTypes(t *testing.T) {
+	src := []byte("package p\n\nvar m = [][]int{[]int{1}}\n")
+
+	out, err := SourceWithConfig(src, DefaultConfig)
+	if err != nil {
+		t.Fatalf("SourceWithConfig: %v", err)
+	}
+	if !strings.Contains(string(out), "[]int{1}") {
+		t.Errorf("without Simplify, the element type should be left alone, got:\n%s", out)
+	}
+}
+
+func TestSourceWithConfigSimplifyRange(t *testing.T) {
+	src := []byte("package p\n\nfunc f(v []int) {\n\tfor _, x := range v {\n\t\t_ = x\n\t}\n\tfor _ = range v {\n\t}\n}\n")
+
+	cfg := DefaultConfig
+	cfg.Simplify = true
+	out, err := SourceWithConfig(src, cfg)
+	if err != nil {
+		t.Fatalf("SourceWithConfig: %v", err)
+	}
+	got := string(out)
+	if strings.Contains(got, "for _ = range") {
+		t.Errorf("simplify should have rewritten \"for _ = range\" to \"for range\", got:\n%s", got)
+	}
+	if !strings.Contains(got, "for range v") {
+		t.Errorf("expected \"for range v\", got:\n%s", got)
+	}
+}